@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kcp-dev/kcp/pkg/reconciler/workload/resource"
+)
+
+// ResourcePlacementOptions holds the flags that scope which namespaces the workload
+// resource-placement controller is allowed to act on.
+type ResourcePlacementOptions struct {
+	AllowedNamespaces        []string
+	DeniedNamespaces         []string
+	AllowedNamespaceSelector string
+	DeniedNamespaceSelector  string
+
+	// SkipGVRs are "group/version/resource" entries (e.g. "networking.k8s.io/v1/ingresses")
+	// that the resource-placement controller will never reconcile, on top of the built-in
+	// ingress skipper.
+	SkipGVRs []string
+
+	// PatchConcurrency bounds how many distinct placement-patch batches are applied
+	// concurrently by the resource-placement controller.
+	PatchConcurrency int
+}
+
+// NewResourcePlacementOptions returns ResourcePlacementOptions with their defaults set.
+func NewResourcePlacementOptions() *ResourcePlacementOptions {
+	return &ResourcePlacementOptions{
+		PatchConcurrency: 10,
+	}
+}
+
+// AddFlags binds the resource-placement namespace scoping flags to fs.
+func (o *ResourcePlacementOptions) AddFlags(fs *pflag.FlagSet) {
+	if o == nil {
+		return
+	}
+
+	fs.StringArrayVar(&o.AllowedNamespaces, "allowed-namespace", o.AllowedNamespaces,
+		"Namespace that the workload resource-placement controller is allowed to assign to clusters. May be repeated. If unset, all namespaces are allowed unless excluded by --allowed-namespace-selector or --denied-namespace(-selector).")
+	fs.StringArrayVar(&o.DeniedNamespaces, "denied-namespace", o.DeniedNamespaces,
+		"Namespace that the workload resource-placement controller must not assign to clusters. May be repeated. Takes precedence over --allowed-namespace(-selector).")
+	fs.StringVar(&o.AllowedNamespaceSelector, "allowed-namespace-selector", o.AllowedNamespaceSelector,
+		"Label selector; only namespaces it matches are allowed to be assigned to clusters.")
+	fs.StringVar(&o.DeniedNamespaceSelector, "denied-namespace-selector", o.DeniedNamespaceSelector,
+		"Label selector; namespaces it matches are never assigned to clusters. Takes precedence over --allowed-namespace-selector.")
+	fs.StringArrayVar(&o.SkipGVRs, "skip-gvr", o.SkipGVRs,
+		"group/version/resource (e.g. networking.k8s.io/v1/ingresses) that the resource-placement controller must never reconcile. May be repeated. Ingresses are always skipped by the built-in filter.")
+	fs.IntVar(&o.PatchConcurrency, "resource-patch-concurrency", o.PatchConcurrency,
+		"Maximum number of distinct placement-patch batches the resource-placement controller applies concurrently.")
+}
+
+// Validate checks that the configured selectors parse.
+func (o *ResourcePlacementOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.AllowedNamespaceSelector != "" {
+		if _, err := labels.Parse(o.AllowedNamespaceSelector); err != nil {
+			return fmt.Errorf("--allowed-namespace-selector is invalid: %w", err)
+		}
+	}
+	if o.DeniedNamespaceSelector != "" {
+		if _, err := labels.Parse(o.DeniedNamespaceSelector); err != nil {
+			return fmt.Errorf("--denied-namespace-selector is invalid: %w", err)
+		}
+	}
+	return nil
+}
+
+// AllowedNamespaceSet returns the configured allow list as a sets.String.
+func (o *ResourcePlacementOptions) AllowedNamespaceSet() sets.String {
+	return sets.NewString(o.AllowedNamespaces...)
+}
+
+// DeniedNamespaceSet returns the configured deny list as a sets.String.
+func (o *ResourcePlacementOptions) DeniedNamespaceSet() sets.String {
+	return sets.NewString(o.DeniedNamespaces...)
+}
+
+// FilterRegistry builds the ResourceFilter registry described by --skip-gvr, plus one
+// skip-GVR filter per object in annotationSources whose SkipGVRAnnotation is set (typically
+// the APIBindings/APIExports visible at call time). It is a point-in-time snapshot: call it
+// again, or call the returned registry's RegisterSkipGVRAnnotation directly, to pick up
+// later changes to those objects.
+func (o *ResourcePlacementOptions) FilterRegistry(annotationSources ...metav1.Object) *resource.FilterRegistry {
+	registry := resource.NewFilterRegistry(resource.ParseSkipGVRs(o.SkipGVRs...)...)
+	for _, obj := range annotationSources {
+		registry.RegisterSkipGVRAnnotation(obj.GetName(), obj.GetAnnotations())
+	}
+	return registry
+}
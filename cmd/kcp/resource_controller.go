@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/kcp-dev/kcp/pkg/informer"
+	"github.com/kcp-dev/kcp/pkg/reconciler/workload/resource"
+)
+
+// NewResourcePlacementController validates opts and constructs the workload
+// resource-placement controller from it, wiring --allowed-namespace(-selector),
+// --denied-namespace(-selector), --skip-gvr and --resource-patch-concurrency through to
+// resource.NewController. It expects the shared dynamic client and the
+// namespace/ConfigMap/discovery informers to be set up already; nothing in this repository
+// calls it.
+//
+// skipGVRAnnotationSourcesAtStartup seeds the filter chain's SkipGVRAnnotation filters from
+// whatever APIBindings/APIExports are visible at construction time only; nothing currently
+// re-registers them as those objects are added, edited or deleted afterward. Callers that
+// need that should call resource.FilterRegistry.RegisterSkipGVRAnnotation themselves from an
+// APIBinding/APIExport informer event handler.
+func NewResourcePlacementController(
+	opts *ResourcePlacementOptions,
+	dynClient dynamic.ClusterInterface,
+	namespaceLister corelisters.NamespaceLister,
+	configMapLister corelisters.ConfigMapLister,
+	ddsif informer.DynamicDiscoverySharedInformerFactory,
+	skipGVRAnnotationSourcesAtStartup ...metav1.Object,
+) (*resource.Controller, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var allowedSelector, deniedSelector labels.Selector
+	var err error
+	if opts.AllowedNamespaceSelector != "" {
+		if allowedSelector, err = labels.Parse(opts.AllowedNamespaceSelector); err != nil {
+			return nil, fmt.Errorf("--allowed-namespace-selector is invalid: %w", err)
+		}
+	}
+	if opts.DeniedNamespaceSelector != "" {
+		if deniedSelector, err = labels.Parse(opts.DeniedNamespaceSelector); err != nil {
+			return nil, fmt.Errorf("--denied-namespace-selector is invalid: %w", err)
+		}
+	}
+
+	return resource.NewController(
+		dynClient,
+		namespaceLister,
+		configMapLister,
+		ddsif,
+		opts.AllowedNamespaceSet(),
+		opts.DeniedNamespaceSet(),
+		allowedSelector,
+		deniedSelector,
+		opts.FilterRegistry(skipGVRAnnotationSourcesAtStartup...),
+		opts.PatchConcurrency,
+	), nil
+}
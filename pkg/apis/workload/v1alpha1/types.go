@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+const (
+	// InternalClusterResourceStateLabelPrefix is the prefix of the label key
+	// that is used to indicate the state of a resource with respect to a
+	// given location. The full key is this prefix plus the location name.
+	InternalClusterResourceStateLabelPrefix = "state.workload.kcp.dev/"
+
+	// InternalClusterDeletionTimestampAnnotationPrefix is the prefix of the
+	// annotation key that is used to record the deletion timestamp of a
+	// resource with respect to a given location. The full key is this prefix
+	// plus the location name.
+	InternalClusterDeletionTimestampAnnotationPrefix = "deletion.internal.workload.kcp.dev/"
+
+	// RolloutGateAnnotation, when set to RolloutGateReady on a namespace, opens the
+	// rollout gate for every location placed on that namespace. It is the simplest way
+	// for an operator to allow the resource controller to promote resources from
+	// ResourceStatePending to ResourceStateSync.
+	RolloutGateAnnotation = "workload.kcp.dev/rollout-gate"
+
+	// RolloutGateReady is the value of RolloutGateAnnotation that opens the gate.
+	RolloutGateReady = "Ready"
+
+	// RolloutGateRefAnnotationPrefix is the prefix of a per-location annotation whose
+	// value names a ConfigMap (in the namespace) that gates the rollout for that one
+	// location. The gate is considered open once the ConfigMap's "ready" data key is "true".
+	RolloutGateRefAnnotationPrefix = "workload.kcp.dev/rollout-gate-ref."
+
+	// PreserveResourcesOnDeletionAnnotation, set to "true" on a namespace, asks the
+	// resource controller not to immediately drop a resource's state label when its
+	// location is withdrawn from the namespace's placement. Instead the resource is moved
+	// to ResourceStateRemoving, giving the syncer a chance to drain the workload and
+	// record status before the label (and the resource at that location) is actually
+	// removed.
+	PreserveResourcesOnDeletionAnnotation = "workload.kcp.dev/preserve-resources-on-deletion"
+
+	// ConflictResolutionAnnotation, set on the object (not the namespace), controls how
+	// computePlacement reconciles the object's state.workload.kcp.dev/<loc> labels against
+	// the namespace's placement when they disagree.
+	ConflictResolutionAnnotation = "workload.kcp.dev/conflict-resolution"
+)
+
+// ConflictResolution is the value of ConflictResolutionAnnotation.
+type ConflictResolution string
+
+const (
+	// ConflictResolutionOverwrite reconciles the object's placement labels to exactly
+	// match the namespace's, removing any location the user added by hand. This is the
+	// default when the annotation is unset.
+	ConflictResolutionOverwrite ConflictResolution = "Overwrite"
+
+	// ConflictResolutionRetain takes the union of the object's and the namespace's
+	// locations: namespace locations missing from the object are added, but a location the
+	// user added to the object is never removed, even once it falls off the namespace's
+	// placement.
+	ConflictResolutionRetain ConflictResolution = "Retain"
+)
+
+// ResourceState describes the state of a resource with respect to a single
+// location it has been (or is being) placed into.
+type ResourceState string
+
+const (
+	// ResourceStatePending means the resource has been assigned to the
+	// location but is waiting on that location's rollout gate to open
+	// before the syncer is allowed to start shipping it.
+	ResourceStatePending ResourceState = "Pending"
+
+	// ResourceStateSync means the resource should be synced to the
+	// location by the syncer.
+	ResourceStateSync ResourceState = "Sync"
+
+	// ResourceStateSynced means the syncer has reported the resource as
+	// present at the location.
+	ResourceStateSynced ResourceState = "Synced"
+
+	// ResourceStateRemoving means the location was withdrawn from the
+	// namespace's placement, but the namespace asked for resources to be
+	// preserved (PreserveResourcesOnDeletionAnnotation) until the syncer has had a chance to
+	// drain the workload, rather than being removed immediately.
+	ResourceStateRemoving ResourceState = "Removing"
+)
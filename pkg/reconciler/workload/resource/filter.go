@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SkipGVRAnnotation, when set on an APIBinding or APIExport, lists additional
+// comma-separated "group/version/resource" GVRs that the resource-placement controller
+// should never reconcile, on top of whatever is registered via --skip-gvr.
+const SkipGVRAnnotation = "workload.kcp.dev/skip-gvr"
+
+// ResourceFilter decides whether an object should be skipped by reconcileResource before
+// any lister lookup or patch is attempted. Filters are combined as a chain: the object is
+// skipped if any filter in the chain returns true.
+type ResourceFilter interface {
+	Skip(gvr schema.GroupVersionResource, lclusterName logicalcluster.Name, obj *unstructured.Unstructured) bool
+}
+
+// ResourceFilterFunc adapts a plain function to a ResourceFilter.
+type ResourceFilterFunc func(gvr schema.GroupVersionResource, lclusterName logicalcluster.Name, obj *unstructured.Unstructured) bool
+
+func (f ResourceFilterFunc) Skip(gvr schema.GroupVersionResource, lclusterName logicalcluster.Name, obj *unstructured.Unstructured) bool {
+	return f(gvr, lclusterName, obj)
+}
+
+// gvrSetFilter skips every object whose GVR is in a fixed set. It backs the GVRs registered
+// via --skip-gvr and SkipGVRAnnotation, where the version matters.
+type gvrSetFilter struct {
+	gvrs map[schema.GroupVersionResource]bool
+}
+
+func (f *gvrSetFilter) Skip(gvr schema.GroupVersionResource, _ logicalcluster.Name, _ *unstructured.Unstructured) bool {
+	return f.gvrs[gvr]
+}
+
+// groupResourceFilter skips every object of a given group+resource, regardless of version.
+type groupResourceFilter struct {
+	group, resource string
+}
+
+func (f *groupResourceFilter) Skip(gvr schema.GroupVersionResource, _ logicalcluster.Name, _ *unstructured.Unstructured) bool {
+	return gvr.Group == f.group && gvr.Resource == f.resource
+}
+
+// newIngressSkipFilter preserves the historical hardcoded behavior of never reconciling
+// networking.k8s.io Ingresses of any version (they are handled by the ingress splitter).
+func newIngressSkipFilter() ResourceFilter {
+	return &groupResourceFilter{group: "networking.k8s.io", resource: "ingresses"}
+}
+
+// ParseSkipGVRs parses a "group/version/resource" list, as used by both --skip-gvr and
+// the SkipGVRAnnotation, into GVRs. Malformed entries are ignored.
+func ParseSkipGVRs(gvrs ...string) []schema.GroupVersionResource {
+	parsed := make([]schema.GroupVersionResource, 0, len(gvrs))
+	for _, raw := range gvrs {
+		for _, entry := range strings.Split(raw, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			parts := strings.Split(entry, "/")
+			if len(parts) != 3 {
+				continue
+			}
+			parsed = append(parsed, schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]})
+		}
+	}
+	return parsed
+}
+
+// FilterRegistry is a named, concurrency-safe chain of ResourceFilters.
+type FilterRegistry struct {
+	mu      sync.RWMutex
+	order   []string
+	filters map[string]ResourceFilter
+}
+
+// NewFilterRegistry returns a registry pre-populated with the built-in ingress skipper and
+// any GVRs passed in (typically sourced from --skip-gvr).
+func NewFilterRegistry(skipGVRs ...schema.GroupVersionResource) *FilterRegistry {
+	r := &FilterRegistry{filters: map[string]ResourceFilter{}}
+	r.Register("ingress", newIngressSkipFilter())
+	if len(skipGVRs) > 0 {
+		gvrs := make(map[schema.GroupVersionResource]bool, len(skipGVRs))
+		for _, gvr := range skipGVRs {
+			gvrs[gvr] = true
+		}
+		r.Register("skip-gvr-flag", &gvrSetFilter{gvrs: gvrs})
+	}
+	return r
+}
+
+// Register adds or replaces the named filter.
+func (r *FilterRegistry) Register(name string, filter ResourceFilter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.filters[name]; !found {
+		r.order = append(r.order, name)
+	}
+	r.filters[name] = filter
+}
+
+// RegisterSkipGVRAnnotation parses SkipGVRAnnotation out of annotations (typically an
+// APIBinding's or APIExport's) and registers the resulting GVRs as the named filter, or
+// deregisters that name if the annotation is absent or empty.
+func (r *FilterRegistry) RegisterSkipGVRAnnotation(name string, annotations map[string]string) {
+	gvrs := ParseSkipGVRs(annotations[SkipGVRAnnotation])
+	if len(gvrs) == 0 {
+		r.Deregister(name)
+		return
+	}
+	set := make(map[schema.GroupVersionResource]bool, len(gvrs))
+	for _, gvr := range gvrs {
+		set[gvr] = true
+	}
+	r.Register(name, &gvrSetFilter{gvrs: set})
+}
+
+// Deregister removes the named filter, if present.
+func (r *FilterRegistry) Deregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.filters[name]; !found {
+		return
+	}
+	delete(r.filters, name)
+	for i, n := range r.order {
+		if n == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Skip reports whether any registered filter vetoes reconciliation of obj.
+func (r *FilterRegistry) Skip(gvr schema.GroupVersionResource, lclusterName logicalcluster.Name, obj *unstructured.Unstructured) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, name := range r.order {
+		if r.filters[name].Skip(gvr, lclusterName, obj) {
+			return true
+		}
+	}
+	return false
+}
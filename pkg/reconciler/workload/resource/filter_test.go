@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestIngressSkipFilterMatchesAnyVersion(t *testing.T) {
+	f := newIngressSkipFilter()
+	for _, version := range []string{"v1", "v1beta1"} {
+		gvr := schema.GroupVersionResource{Group: "networking.k8s.io", Version: version, Resource: "ingresses"}
+		if !f.Skip(gvr, logicalcluster.New("root"), &unstructured.Unstructured{}) {
+			t.Errorf("expected ingresses/%s to be skipped", version)
+		}
+	}
+
+	other := schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+	if f.Skip(other, logicalcluster.New("root"), &unstructured.Unstructured{}) {
+		t.Errorf("did not expect networkpolicies to be skipped")
+	}
+}
+
+func TestFilterRegistrySkipGVRAnnotation(t *testing.T) {
+	r := NewFilterRegistry()
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+
+	r.RegisterSkipGVRAnnotation("binding-a", map[string]string{SkipGVRAnnotation: "example.com/v1/widgets"})
+	if !r.Skip(gvr, logicalcluster.New("root"), &unstructured.Unstructured{}) {
+		t.Fatalf("expected widgets to be skipped once registered from the annotation")
+	}
+
+	r.RegisterSkipGVRAnnotation("binding-a", nil)
+	if r.Skip(gvr, logicalcluster.New("root"), &unstructured.Unstructured{}) {
+		t.Fatalf("expected widgets to no longer be skipped once the annotation is cleared")
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// placementPatchBatchSize records how many objects shared an identical placement patch
+	// and were applied together as one batch.
+	placementPatchBatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kcp_workload_resource_placement_patch_batch_size",
+		Help:    "Number of objects sharing an identical placement patch applied together as one batch.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"resource"})
+
+	// placementPatchLatency records the latency of a single placement merge patch.
+	placementPatchLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kcp_workload_resource_placement_patch_duration_seconds",
+		Help:    "Latency of a single placement merge patch, by GVR.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"resource"})
+)
+
+func init() {
+	prometheus.MustRegister(placementPatchBatchSize, placementPatchLatency)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/kcp-dev/kcp/pkg/informer"
+)
+
+// Controller watches namespaced resources across all informed GVRs and
+// assigns them to the cluster their namespace has been placed on.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	dynClient       dynamic.ClusterInterface
+	namespaceLister corelisters.NamespaceLister
+	configMapLister corelisters.ConfigMapLister
+	ddsif           informer.DynamicDiscoverySharedInformerFactory
+
+	// allowedNamespaces and deniedNamespaces, when non-empty, restrict reconciliation to
+	// (resp. exclude) namespaces by name. deniedNamespaces takes precedence.
+	allowedNamespaces sets.String
+	deniedNamespaces  sets.String
+
+	// allowedNamespaceSelector and deniedNamespaceSelector are the label-selector
+	// equivalents of allowedNamespaces/deniedNamespaces.
+	allowedNamespaceSelector labels.Selector
+	deniedNamespaceSelector  labels.Selector
+
+	// filters is the chain of ResourceFilters consulted by reconcileResource before any
+	// lister lookup is attempted. It defaults to a registry containing just the built-in
+	// ingress skipper.
+	filters *FilterRegistry
+
+	// patchParallelism bounds how many placement-patch batches reconcileGVR applies
+	// concurrently. Zero means defaultPatchParallelism.
+	patchParallelism int
+}
+
+// defaultPatchParallelism is used when patchParallelism is unset.
+const defaultPatchParallelism = 10
+
+// namespaceAllowed reports whether ns is in scope for this controller, applying the
+// allow/deny name sets and label selectors configured via --allowed-namespace,
+// --denied-namespace, --allowed-namespace-selector and --denied-namespace-selector.
+func (c *Controller) namespaceAllowed(ns *corev1.Namespace) bool {
+	if c.deniedNamespaces.Len() > 0 && c.deniedNamespaces.Has(ns.Name) {
+		return false
+	}
+	if c.deniedNamespaceSelector != nil && c.deniedNamespaceSelector.Matches(labels.Set(ns.Labels)) {
+		return false
+	}
+	if c.allowedNamespaces.Len() > 0 && !c.allowedNamespaces.Has(ns.Name) {
+		return false
+	}
+	if c.allowedNamespaceSelector != nil && !c.allowedNamespaceSelector.Matches(labels.Set(ns.Labels)) {
+		return false
+	}
+	return true
+}
+
+// NewController returns a new Controller watching the namespaced resources known to ddsif
+// and assigning them to the cluster their namespace is placed on.
+func NewController(
+	dynClient dynamic.ClusterInterface,
+	namespaceLister corelisters.NamespaceLister,
+	configMapLister corelisters.ConfigMapLister,
+	ddsif informer.DynamicDiscoverySharedInformerFactory,
+	allowedNamespaces, deniedNamespaces sets.String,
+	allowedNamespaceSelector, deniedNamespaceSelector labels.Selector,
+	filters *FilterRegistry,
+	patchParallelism int,
+) *Controller {
+	if filters == nil {
+		filters = NewFilterRegistry()
+	}
+	return &Controller{
+		queue:                    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "resource-placement"),
+		dynClient:                dynClient,
+		namespaceLister:          namespaceLister,
+		configMapLister:          configMapLister,
+		ddsif:                    ddsif,
+		allowedNamespaces:        allowedNamespaces,
+		deniedNamespaces:         deniedNamespaces,
+		allowedNamespaceSelector: allowedNamespaceSelector,
+		deniedNamespaceSelector:  deniedNamespaceSelector,
+		filters:                  filters,
+		patchParallelism:         patchParallelism,
+	}
+}
+
+func (c *Controller) enqueueResource(gvr schema.GroupVersionResource, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.queue.Add(gvrKey{gvr: gvr, key: key})
+}
+
+type gvrKey struct {
+	gvr schema.GroupVersionResource
+	key string
+}
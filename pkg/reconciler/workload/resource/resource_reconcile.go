@@ -18,19 +18,24 @@ package resource
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kcp-dev/logicalcluster"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/clusters"
 	"k8s.io/klog/v2"
 
@@ -40,8 +45,13 @@ import (
 // reconcileResource is responsible for setting the cluster for a resource of
 // any type, to match the cluster where its namespace is assigned.
 func (c *Controller) reconcileResource(ctx context.Context, lclusterName logicalcluster.Name, obj *unstructured.Unstructured, gvr *schema.GroupVersionResource) error {
-	if gvr.Group == "networking.k8s.io" && gvr.Resource == "ingresses" {
-		klog.V(4).Infof("Skipping reconciliation of ingress %s/%s", obj.GetNamespace(), obj.GetName())
+	if c.deniedNamespaces.Has(obj.GetNamespace()) || (c.allowedNamespaces.Len() > 0 && !c.allowedNamespaces.Has(obj.GetNamespace())) {
+		klog.V(4).Infof("Namespace %s is excluded by --allowed-namespace/--denied-namespace; ignoring %s|%s/%s", obj.GetNamespace(), gvr.String(), lclusterName, obj.GetName())
+		return nil
+	}
+
+	if c.filters != nil && c.filters.Skip(*gvr, lclusterName, obj) {
+		klog.V(4).Infof("Skipping reconciliation of %q %s|%s/%s: filtered", gvr.String(), lclusterName, obj.GetNamespace(), obj.GetName())
 		return nil
 	}
 
@@ -66,34 +76,19 @@ func (c *Controller) reconcileResource(ctx context.Context, lclusterName logical
 		return fmt.Errorf("error reconciling resource %s|%s/%s: error getting namespace: %w", lclusterName, obj.GetNamespace(), obj.GetName(), err)
 	}
 
-	annotationPatch, labelPatch := computePlacement(ns, obj)
+	if !c.namespaceAllowed(ns) {
+		klog.V(4).Infof("Namespace %s is excluded by namespace selector; ignoring %s|%s/%s", ns.Name, gvr.String(), lclusterName, obj.GetName())
+		return nil
+	}
+
+	annotationPatch, labelPatch := computePlacement(ns, obj, c.isRolloutGateReady)
 
 	// create patch
 	if len(labelPatch) == 0 && len(annotationPatch) == 0 {
 		return nil
 	}
 
-	patch := map[string]interface{}{}
-	if len(labelPatch) > 0 {
-		if err := unstructured.SetNestedField(patch, labelPatch, "metadata", "labels"); err != nil {
-			klog.Errorf("unexpected unstructured error: %v", err)
-			return err // should never happen
-		}
-	}
-	if len(annotationPatch) > 0 {
-		if err := unstructured.SetNestedField(patch, labelPatch, "metadata", "annotations"); err != nil {
-			klog.Errorf("unexpected unstructured error: %v", err)
-			return err // should never happen
-		}
-	}
-	patchBytes, err := json.Marshal(patch)
-	if err != nil {
-		klog.Errorf("unexpected marshal error: %v", err)
-		return err
-	}
-
-	if _, err := c.dynClient.Cluster(lclusterName).Resource(*gvr).Namespace(ns.Name).
-		Patch(ctx, obj.GetName(), types.MergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
+	if err := c.applyPlacementPatch(ctx, *gvr, lclusterName, ns.Name, obj.GetName(), annotationPatch, labelPatch); err != nil {
 		return err
 	}
 
@@ -111,11 +106,26 @@ func (c *Controller) reconcileResource(ctx context.Context, lclusterName logical
 	return nil
 }
 
+// hasPendingPromotion reports whether any loc in shared is Pending on obj and its gate has
+// since opened, i.e. whether computePlacement has work to do even though the namespace and
+// object location sets already agree.
+func hasPendingPromotion(ns *corev1.Namespace, obj metav1.Object, shared sets.String, gateReady func(ns *corev1.Namespace, loc string) bool) bool {
+	for _, loc := range shared.List() {
+		if obj.GetLabels()[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] == string(workloadv1alpha1.ResourceStatePending) && gateReady(ns, loc) {
+			return true
+		}
+	}
+	return false
+}
+
 // computePlacement computes the patch against annotations and labels. Nil means to remove the key.
-func computePlacement(ns *corev1.Namespace, obj metav1.Object) (annotationPatch map[string]interface{}, labelPatch map[string]interface{}) {
+//
+// gateReady gates a location's first promotion to ResourceStateSync behind a namespace
+// rollout gate (see isRolloutGateReady).
+func computePlacement(ns *corev1.Namespace, obj metav1.Object, gateReady func(ns *corev1.Namespace, loc string) bool) (annotationPatch map[string]interface{}, labelPatch map[string]interface{}) {
 	nsLocations, nsDeleting := locations(ns.Annotations, ns.Labels, true)
 	objLocations, objDeleting := locations(obj.GetAnnotations(), obj.GetLabels(), false)
-	if objLocations.Equal(nsLocations) && objDeleting.Equal(nsDeleting) {
+	if objLocations.Equal(nsLocations) && objDeleting.Equal(nsDeleting) && !hasPendingPromotion(ns, obj, objLocations.Intersection(nsLocations), gateReady) {
 		// already correctly assigned.
 		return
 	}
@@ -123,8 +133,28 @@ func computePlacement(ns *corev1.Namespace, obj metav1.Object) (annotationPatch
 	// create merge patch
 	annotationPatch = map[string]interface{}{}
 	labelPatch = map[string]interface{}{}
-	for _, loc := range objLocations.Difference(nsLocations).List() {
+	// conflictResolution: Overwrite (default) reconciles user-added locations away;
+	// Retain keeps them and only adds what's missing from the namespace.
+	conflictResolution := workloadv1alpha1.ConflictResolution(obj.GetAnnotations()[workloadv1alpha1.ConflictResolutionAnnotation])
+	userAdded := objLocations.Difference(nsLocations)
+
+	preserveOnDeletion := ns.Annotations[workloadv1alpha1.PreserveResourcesOnDeletionAnnotation] == "true"
+	for _, loc := range userAdded.List() {
+		if conflictResolution == workloadv1alpha1.ConflictResolutionRetain {
+			// user-added location: never delete labels the user added.
+			continue
+		}
 		// location was removed from namespace, but is still on the object
+		if preserveOnDeletion {
+			// let the syncer drain and record status before the resource is actually removed
+			labelPatch[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] = string(workloadv1alpha1.ResourceStateRemoving)
+			if nsTimestamp, found := ns.Annotations[workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix+loc]; found && validRFC3339(nsTimestamp) {
+				if objTimestamp, found := obj.GetAnnotations()[workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix+loc]; !found || objTimestamp != nsTimestamp {
+					annotationPatch[workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix+loc] = nsTimestamp
+				}
+			}
+			continue
+		}
 		labelPatch[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] = nil
 		if _, found := obj.GetAnnotations()[workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix+loc]; found {
 			annotationPatch[workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix+loc] = nil
@@ -140,8 +170,17 @@ func computePlacement(ns *corev1.Namespace, obj metav1.Object) (annotationPatch
 	}
 	for _, loc := range nsLocations.Difference(objLocations).List() {
 		// location was missing on the object
-		// TODO(sttts): add way to go into pending state first, maybe with a namespace annotation
-		labelPatch[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] = string(workloadv1alpha1.ResourceStateSync)
+		if gateReady(ns, loc) {
+			labelPatch[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] = string(workloadv1alpha1.ResourceStateSync)
+		} else {
+			labelPatch[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] = string(workloadv1alpha1.ResourceStatePending)
+		}
+	}
+	for _, loc := range nsLocations.Intersection(objLocations).List() {
+		// promote a pending location once its gate opens
+		if obj.GetLabels()[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] == string(workloadv1alpha1.ResourceStatePending) && gateReady(ns, loc) {
+			labelPatch[workloadv1alpha1.InternalClusterResourceStateLabelPrefix+loc] = string(workloadv1alpha1.ResourceStateSync)
+		}
 	}
 
 	if len(annotationPatch) == 0 {
@@ -154,6 +193,16 @@ func computePlacement(ns *corev1.Namespace, obj metav1.Object) (annotationPatch
 	return
 }
 
+// placementBatch is a set of objects of the same GVR, in the same logical cluster and
+// namespace, that all need the exact same placement patch applied.
+type placementBatch struct {
+	namespace       string
+	lclusterName    logicalcluster.Name
+	annotationPatch map[string]interface{}
+	labelPatch      map[string]interface{}
+	names           []string
+}
+
 func (c *Controller) reconcileGVR(gvr schema.GroupVersionResource) error {
 	listers, _ := c.ddsif.Listers()
 	lister, found := listers[gvr]
@@ -166,13 +215,187 @@ func (c *Controller) reconcileGVR(gvr schema.GroupVersionResource) error {
 	if err != nil {
 		return err
 	}
+
+	batches := map[string]*placementBatch{}
 	for _, obj := range objs {
-		c.enqueueResource(gvr, obj)
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			klog.Errorf("unexpected object without meta accessor for %q: %v", gvr, err)
+			continue
+		}
+		if c.deniedNamespaces.Has(accessor.GetNamespace()) || (c.allowedNamespaces.Len() > 0 && !c.allowedNamespaces.Has(accessor.GetNamespace())) {
+			// Skip enqueueing excluded namespaces entirely rather than filtering them out
+			// once popped off the queue.
+			continue
+		}
+
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || accessor.GetNamespace() == "" {
+			// Not something we know how to batch (or cluster-scoped); fall back to the
+			// single-object path, which handles those cases on its own.
+			c.enqueueResource(gvr, obj)
+			continue
+		}
+
+		lclusterName := logicalcluster.From(u)
+		ns, err := c.namespaceLister.Get(clusters.ToClusterAwareKey(lclusterName, u.GetNamespace()))
+		if err != nil {
+			// Let the per-object path deal with NotFound/transient lister errors.
+			c.enqueueResource(gvr, obj)
+			continue
+		}
+		if !c.namespaceAllowed(ns) || (c.filters != nil && c.filters.Skip(gvr, lclusterName, u)) {
+			continue
+		}
+
+		annotationPatch, labelPatch := computePlacement(ns, u, c.isRolloutGateReady)
+		if len(annotationPatch) == 0 && len(labelPatch) == 0 {
+			continue
+		}
+
+		key := placementBatchKey(gvr, lclusterName, u.GetNamespace(), annotationPatch, labelPatch)
+		batch, found := batches[key]
+		if !found {
+			batch = &placementBatch{
+				namespace:       u.GetNamespace(),
+				lclusterName:    lclusterName,
+				annotationPatch: annotationPatch,
+				labelPatch:      labelPatch,
+			}
+			batches[key] = batch
+		}
+		batch.names = append(batch.names, u.GetName())
 	}
-	return nil
+
+	if len(batches) == 0 {
+		return nil
+	}
+
+	concurrency := c.patchConcurrency()
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for _, batch := range batches {
+		batch := batch
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			placementPatchBatchSize.WithLabelValues(gvr.String()).Observe(float64(len(batch.names)))
+			for _, name := range batch.names {
+				if err := c.applyPlacementPatch(context.Background(), gvr, batch.lclusterName, batch.namespace, name, batch.annotationPatch, batch.labelPatch); err != nil {
+					klog.Errorf("error applying batched placement patch for %q %s|%s/%s: %v", gvr, batch.lclusterName, batch.namespace, name, err)
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// placementBatchKey groups objects of the same GVR, logical cluster and namespace that
+// share an identical computed placement patch, so the batch can be applied via a single
+// worker instead of one goroutine per object.
+func placementBatchKey(gvr schema.GroupVersionResource, lclusterName logicalcluster.Name, namespace string, annotationPatch, labelPatch map[string]interface{}) string {
+	annotationBytes, _ := json.Marshal(annotationPatch)
+	labelBytes, _ := json.Marshal(labelPatch)
+	sum := sha256.Sum256(append(annotationBytes, labelBytes...))
+	return fmt.Sprintf("%s|%s|%s|%x", gvr.String(), lclusterName, namespace, sum)
+}
+
+// patchConcurrency bounds how many placement-patch batches reconcileGVR applies at once.
+func (c *Controller) patchConcurrency() int {
+	if c.patchParallelism > 0 {
+		return c.patchParallelism
+	}
+	return defaultPatchParallelism
+}
+
+// isRolloutGateReady reports whether the rollout gate for loc is open, i.e. whether the
+// resource controller is allowed to promote an object from ResourceStatePending to
+// ResourceStateSync for that location. With no gate configured on the namespace, the gate
+// is considered open, preserving the previous unconditional-sync behavior.
+func (c *Controller) isRolloutGateReady(ns *corev1.Namespace, loc string) bool {
+	if ns.Annotations[workloadv1alpha1.RolloutGateAnnotation] == workloadv1alpha1.RolloutGateReady {
+		return true
+	}
+
+	ref, found := ns.Annotations[workloadv1alpha1.RolloutGateRefAnnotationPrefix+loc]
+	if !found {
+		return true
+	}
+	if c.configMapLister == nil {
+		return false
+	}
+	gate, err := c.configMapLister.ConfigMaps(ns.Name).Get(ref)
+	if err != nil {
+		return false
+	}
+	return gate.Data["ready"] == "true"
+}
+
+// applyPlacementPatch merge-patches the given annotation/label delta for a single object,
+// recording patch latency for gvr. This must stay a merge patch, not a server-side apply:
+// computePlacement only ever returns the locations that changed, and SSA would prune every
+// location label/annotation it owns but that isn't in that delta.
+func (c *Controller) applyPlacementPatch(ctx context.Context, gvr schema.GroupVersionResource, lclusterName logicalcluster.Name, namespace, name string, annotationPatch, labelPatch map[string]interface{}) error {
+	metadata := map[string]interface{}{}
+	if len(labelPatch) > 0 {
+		metadata["labels"] = labelPatch
+	}
+	if len(annotationPatch) > 0 {
+		metadata["annotations"] = annotationPatch
+	}
+	patch := map[string]interface{}{
+		"metadata": metadata,
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		klog.Errorf("unexpected marshal error: %v", err)
+		return err
+	}
+
+	start := time.Now()
+	_, err = c.dynClient.Cluster(lclusterName).Resource(gvr).Namespace(namespace).
+		Patch(ctx, name, types.MergePatchType, patchBytes, metav1.PatchOptions{})
+	placementPatchLatency.WithLabelValues(gvr.String()).Observe(time.Since(start).Seconds())
+	return err
 }
 
 func validRFC3339(ts string) bool {
 	_, err := time.Parse(time.RFC3339, ts)
 	return err == nil
 }
+
+// locations returns the set of locations present in lbls via the
+// InternalClusterResourceStateLabelPrefix labels, and, when includeDeleting is set, every
+// location marked for deletion via a valid InternalClusterDeletionTimestampAnnotationPrefix
+// annotation, whether or not it also has a state label.
+func locations(annotations, lbls map[string]string, includeDeleting bool) (locs sets.String, deleting sets.String) {
+	locs = sets.NewString()
+	deleting = sets.NewString()
+	for k := range lbls {
+		if loc := strings.TrimPrefix(k, workloadv1alpha1.InternalClusterResourceStateLabelPrefix); loc != k {
+			locs.Insert(loc)
+		}
+	}
+	if !includeDeleting {
+		return locs, deleting
+	}
+	for k, v := range annotations {
+		if loc := strings.TrimPrefix(k, workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix); loc != k && validRFC3339(v) {
+			deleting.Insert(loc)
+		}
+	}
+	return locs, deleting
+}
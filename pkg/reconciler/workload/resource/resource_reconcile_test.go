@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func stateLabel(loc string) string {
+	return workloadv1alpha1.InternalClusterResourceStateLabelPrefix + loc
+}
+
+func namespacedObj(labels, annotations map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetName("obj")
+	obj.SetNamespace("ns1")
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+func TestComputePlacementPromotesPendingOnceGateOpens(t *testing.T) {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "ns1",
+			Labels: map[string]string{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)},
+		},
+	}
+	obj := namespacedObj(map[string]string{stateLabel("loc1"): string(workloadv1alpha1.ResourceStatePending)}, nil)
+
+	// Gate closed: the location sets already agree, so computePlacement must not produce
+	// a patch, but it also must not have silently dropped the Pending state.
+	_, labelPatch := computePlacement(ns, obj, func(*corev1.Namespace, string) bool { return false })
+	if labelPatch != nil {
+		t.Fatalf("expected no patch while gate is closed, got %v", labelPatch)
+	}
+
+	// Gate open: even though the location sets are unchanged (both already contain loc1),
+	// the Pending->Sync promotion must still be computed. This is a regression test for the
+	// early-return short-circuit swallowing promotions.
+	_, labelPatch = computePlacement(ns, obj, func(*corev1.Namespace, string) bool { return true })
+	if got := labelPatch[stateLabel("loc1")]; got != string(workloadv1alpha1.ResourceStateSync) {
+		t.Fatalf("expected loc1 to be promoted to Sync, got %v", got)
+	}
+}
+
+func TestComputePlacementGatesNewLocation(t *testing.T) {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "ns1",
+			Labels: map[string]string{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)},
+		},
+	}
+	obj := namespacedObj(nil, nil)
+
+	_, labelPatch := computePlacement(ns, obj, func(*corev1.Namespace, string) bool { return false })
+	if got := labelPatch[stateLabel("loc1")]; got != string(workloadv1alpha1.ResourceStatePending) {
+		t.Fatalf("expected loc1 to start Pending behind a closed gate, got %v", got)
+	}
+
+	_, labelPatch = computePlacement(ns, obj, func(*corev1.Namespace, string) bool { return true })
+	if got := labelPatch[stateLabel("loc1")]; got != string(workloadv1alpha1.ResourceStateSync) {
+		t.Fatalf("expected loc1 to go straight to Sync with an open gate, got %v", got)
+	}
+}
+
+func TestComputePlacementPreservesOnDeletion(t *testing.T) {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ns1",
+			Annotations: map[string]string{
+				workloadv1alpha1.PreserveResourcesOnDeletionAnnotation: "true",
+			},
+		},
+	}
+	obj := namespacedObj(map[string]string{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)}, nil)
+
+	_, labelPatch := computePlacement(ns, obj, func(*corev1.Namespace, string) bool { return true })
+	if got := labelPatch[stateLabel("loc1")]; got != string(workloadv1alpha1.ResourceStateRemoving) {
+		t.Fatalf("expected loc1 to move to Removing rather than be dropped, got %v", got)
+	}
+}
+
+func TestComputePlacementConflictResolutionRetain(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}}
+	obj := namespacedObj(
+		map[string]string{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)},
+		map[string]string{workloadv1alpha1.ConflictResolutionAnnotation: string(workloadv1alpha1.ConflictResolutionRetain)},
+	)
+
+	// loc1 was removed from the namespace's placement, but Retain means the user-added
+	// location must not be reconciled away.
+	_, labelPatch := computePlacement(ns, obj, func(*corev1.Namespace, string) bool { return true })
+	if _, found := labelPatch[stateLabel("loc1")]; found {
+		t.Fatalf("expected loc1 to be retained, got a patch for it: %v", labelPatch[stateLabel("loc1")])
+	}
+}
+
+func TestComputePlacementConflictResolutionOverwrite(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}}
+	obj := namespacedObj(map[string]string{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)}, nil)
+
+	// Default (Overwrite) behavior: a location the namespace no longer has must be
+	// reconciled away.
+	_, labelPatch := computePlacement(ns, obj, func(*corev1.Namespace, string) bool { return true })
+	if _, found := labelPatch[stateLabel("loc1")]; !found || labelPatch[stateLabel("loc1")] != nil {
+		t.Fatalf("expected loc1's label to be removed, got %v", labelPatch[stateLabel("loc1")])
+	}
+}
+
+func TestPlacementBatchKeyGroupsIdenticalPatches(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"}
+	cluster := logicalcluster.New("root")
+	labelPatch := map[string]interface{}{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)}
+
+	a := placementBatchKey(gvr, cluster, "ns1", nil, labelPatch)
+	b := placementBatchKey(gvr, cluster, "ns1", nil, map[string]interface{}{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)})
+	if a != b {
+		t.Fatalf("expected two objects with an identical computed patch to share a batch key, got %q and %q", a, b)
+	}
+}
+
+func TestPlacementBatchKeyDiffersByPatchNamespaceGVRAndCluster(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"}
+	otherGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}
+	cluster := logicalcluster.New("root")
+	otherCluster := logicalcluster.New("other")
+	labelPatch := map[string]interface{}{stateLabel("loc1"): string(workloadv1alpha1.ResourceStateSync)}
+	otherLabelPatch := map[string]interface{}{stateLabel("loc1"): string(workloadv1alpha1.ResourceStatePending)}
+
+	base := placementBatchKey(gvr, cluster, "ns1", nil, labelPatch)
+	cases := map[string]string{
+		"different patch":     placementBatchKey(gvr, cluster, "ns1", nil, otherLabelPatch),
+		"different namespace": placementBatchKey(gvr, cluster, "ns2", nil, labelPatch),
+		"different gvr":       placementBatchKey(otherGVR, cluster, "ns1", nil, labelPatch),
+		"different cluster":   placementBatchKey(gvr, otherCluster, "ns1", nil, labelPatch),
+	}
+	for name, key := range cases {
+		if key == base {
+			t.Errorf("%s: expected a distinct batch key, got the same one as the base case", name)
+		}
+	}
+}
+
+func TestPatchConcurrencyDefaultsWhenUnset(t *testing.T) {
+	c := &Controller{}
+	if got := c.patchConcurrency(); got != defaultPatchParallelism {
+		t.Fatalf("expected patchConcurrency() to fall back to defaultPatchParallelism (%d), got %d", defaultPatchParallelism, got)
+	}
+
+	c.patchParallelism = 3
+	if got := c.patchConcurrency(); got != 3 {
+		t.Fatalf("expected patchConcurrency() to use the configured value, got %d", got)
+	}
+}
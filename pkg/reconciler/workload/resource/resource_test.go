@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestNamespaceAllowed(t *testing.T) {
+	mustSelector := func(s string) labels.Selector {
+		sel, err := labels.Parse(s)
+		if err != nil {
+			t.Fatalf("failed to parse selector %q: %v", s, err)
+		}
+		return sel
+	}
+
+	tests := map[string]struct {
+		c    *Controller
+		ns   *corev1.Namespace
+		want bool
+	}{
+		"no restrictions": {
+			c:    &Controller{},
+			ns:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}},
+			want: true,
+		},
+		"denied by name": {
+			c:    &Controller{deniedNamespaces: sets.NewString("ns1")},
+			ns:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}},
+			want: false,
+		},
+		"not in allow list": {
+			c:    &Controller{allowedNamespaces: sets.NewString("ns2")},
+			ns:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}},
+			want: false,
+		},
+		"in allow list": {
+			c:    &Controller{allowedNamespaces: sets.NewString("ns1")},
+			ns:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}},
+			want: true,
+		},
+		"deny selector takes precedence over allow list": {
+			c: &Controller{
+				allowedNamespaces:       sets.NewString("ns1"),
+				deniedNamespaceSelector: mustSelector("team=a"),
+			},
+			ns:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: map[string]string{"team": "a"}}},
+			want: false,
+		},
+		"allow selector must match": {
+			c:    &Controller{allowedNamespaceSelector: mustSelector("team=a")},
+			ns:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: map[string]string{"team": "b"}}},
+			want: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.c.namespaceAllowed(tc.ns); got != tc.want {
+				t.Errorf("namespaceAllowed() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}